@@ -0,0 +1,17 @@
+// Copyright (c) 2015-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package sharedchannel
+
+import (
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+// AppIface is the interface to the subset of the app layer that the shared
+// channel service depends on. It exists so the service can be unit tested
+// without standing up a full app.App.
+type AppIface interface {
+	GetOrCreateDirectChannel(userID, otherUserID string, channelOptions ...model.ChannelOption) (*model.Channel, *model.AppError)
+	GetOrCreateGroupChannel(userIDs []string) (*model.Channel, *model.AppError)
+	PatchChannelModerationsForChannel(channel *model.Channel, patch []*model.ChannelModerationPatch) ([]*model.ChannelModeration, *model.AppError)
+}
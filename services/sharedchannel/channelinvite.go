@@ -0,0 +1,238 @@
+// Copyright (c) 2015-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package sharedchannel
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/services/remotecluster"
+)
+
+// channelInviteMsg represents an invitation, sent by a remote cluster, to
+// share one of its channels with this cluster. It is exchanged as the
+// payload of a model.RemoteClusterMsg.
+type channelInviteMsg struct {
+	ChannelId string `json:"channel_id"`
+	TeamId    string `json:"team_id"`
+	ReadOnly  bool   `json:"read_only"`
+	Type      string `json:"type"`
+
+	// InvitationId uniquely identifies this invitation so that retransmitted
+	// deliveries of the same invitation, even if re-signed with a fresh
+	// envelope, can be recognized and short-circuited instead of being
+	// reapplied.
+	InvitationId string `json:"invitation_id,omitempty"`
+
+	// Moderation prescribes the exact permission/role combination the
+	// inviting cluster wants applied to the channel, mirroring
+	// model.ChannelModerationPatch. When set, it is applied as-is and
+	// ReadOnly is not used to patch moderation (it is still recorded on the
+	// SharedChannel); ReadOnly remains a backward-compatible shortcut
+	// for disabling create_post and add_reaction for members and guests.
+	Moderation []*model.ChannelModerationPatch `json:"moderation,omitempty"`
+
+	// DirectParticipantIDs holds the user ids that make up the channel
+	// being shared. For a direct channel (model.CHANNEL_DIRECT) it holds
+	// exactly two ids; for a group channel (model.CHANNEL_GROUP) it holds
+	// every member of the group. The name is kept for backward
+	// compatibility with existing invitations.
+	DirectParticipantIDs []string `json:"direct_participant_ids,omitempty"`
+}
+
+// onReceiveChannelInvite is invoked when a channel invitation is received
+// from a remote cluster. It verifies the signed envelope, does nothing for
+// an invitation id already handled, and then either defers the invitation
+// as pending (when the policy does not accept it) or accepts it via
+// acceptInvitation.
+func (scs *Service) onReceiveChannelInvite(msg model.RemoteClusterMsg, rc *model.RemoteCluster, response *remotecluster.Response) error {
+	if len(msg.Payload) == 0 {
+		return nil
+	}
+
+	var envelope signedInviteEnvelope
+	if err := json.Unmarshal(msg.Payload, &envelope); err != nil {
+		return fmt.Errorf("invalid channel invite envelope: %w", err)
+	}
+
+	if err := scs.verifyInviteEnvelope(&envelope, rc); err != nil {
+		return fmt.Errorf("cannot verify channel invite from remote cluster `%s`: %w", rc.RemoteId, err)
+	}
+
+	var invitation channelInviteMsg
+	if err := json.Unmarshal(envelope.Payload, &invitation); err != nil {
+		return fmt.Errorf("invalid channel invite msg: %w", err)
+	}
+
+	if invitation.InvitationId != "" && scs.dedupe.Seen(rc.RemoteId, invitation.InvitationId) {
+		return nil
+	}
+
+	var err error
+	if scs.policy != nil && !scs.policy.Evaluate(rc, &invitation) {
+		err = scs.deferInvitation(rc, &invitation)
+	} else {
+		err = scs.acceptInvitation(rc, &invitation)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Only record the invitation as seen once it has actually been acted
+	// upon. Recording it up front would cause a retry of a failed first
+	// attempt (transient store error, app call failure, etc.) to be
+	// silently short-circuited to success without ever creating/sharing
+	// the channel.
+	if invitation.InvitationId != "" {
+		if err = scs.dedupe.Record(rc.RemoteId, invitation.InvitationId); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// deferInvitation persists invitation as pending instead of acting on it.
+// It is later acted upon via ApproveInvitation, or discarded via
+// RejectInvitation.
+func (scs *Service) deferInvitation(rc *model.RemoteCluster, invitation *channelInviteMsg) error {
+	_, err := scs.pending.Save(&PendingInvitation{
+		RemoteClusterId:        rc.RemoteId,
+		RemoteClusterCreatorId: rc.CreatorId,
+		Invitation:             *invitation,
+	})
+	if err != nil {
+		return fmt.Errorf("cannot persist pending invitation for channel `%s`: %w", invitation.ChannelId, err)
+	}
+
+	return nil
+}
+
+// acceptInvitation creates (or locates) the local channel being shared,
+// records the shared channel/remote bookkeeping, and applies any
+// moderation requested by the inviting cluster.
+func (scs *Service) acceptInvitation(rc *model.RemoteCluster, invitation *channelInviteMsg) error {
+	channel, err := scs.server.GetStore().Channel().Get(invitation.ChannelId, true)
+	if err != nil {
+		channel, err = scs.createChannelFromInvitation(invitation, rc)
+		if err != nil {
+			return err
+		}
+
+		if err = scs.shareChannel(channel, invitation, rc); err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case len(invitation.Moderation) > 0:
+		if err = scs.applyModerationPatch(channel, invitation); err != nil {
+			return err
+		}
+	case invitation.ReadOnly:
+		if err = scs.makeChannelReadOnly(channel, invitation); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// createChannelFromInvitation creates the local channel prescribed by the
+// invitation. The channel type dictates which app method is used to create
+// it.
+func (scs *Service) createChannelFromInvitation(invitation *channelInviteMsg, rc *model.RemoteCluster) (*model.Channel, error) {
+	switch invitation.Type {
+	case model.CHANNEL_DIRECT:
+		if len(invitation.DirectParticipantIDs) != 2 {
+			return nil, fmt.Errorf("cannot create direct channel for invite `%s`: expected 2 participants, got %d", invitation.ChannelId, len(invitation.DirectParticipantIDs))
+		}
+		channel, appErr := scs.app.GetOrCreateDirectChannel(invitation.DirectParticipantIDs[0], invitation.DirectParticipantIDs[1], model.ChannelOptionSkipNotification())
+		if appErr != nil {
+			return nil, fmt.Errorf("cannot create direct channel for invite `%s`: %w", invitation.ChannelId, appErr)
+		}
+		return channel, nil
+	case model.CHANNEL_GROUP:
+		if len(invitation.DirectParticipantIDs) < 3 {
+			return nil, fmt.Errorf("cannot create group channel for invite `%s`: expected at least 3 participants, got %d", invitation.ChannelId, len(invitation.DirectParticipantIDs))
+		}
+		channel, appErr := scs.app.GetOrCreateGroupChannel(invitation.DirectParticipantIDs)
+		if appErr != nil {
+			return nil, fmt.Errorf("cannot create group channel for invite `%s`: %w", invitation.ChannelId, appErr)
+		}
+		return channel, nil
+	default:
+		return nil, fmt.Errorf("cannot create channel for invite `%s`: unsupported channel type `%s`", invitation.ChannelId, invitation.Type)
+	}
+}
+
+// shareChannel records the bookkeeping needed to treat channel as shared
+// with the remote cluster that sent the invitation.
+func (scs *Service) shareChannel(channel *model.Channel, invitation *channelInviteMsg, rc *model.RemoteCluster) error {
+	sc := &model.SharedChannel{
+		ChannelId: channel.Id,
+		TeamId:    invitation.TeamId,
+		Home:      false,
+		ReadOnly:  invitation.ReadOnly,
+		ShareName: channel.Name,
+		CreatorId: rc.CreatorId,
+		RemoteId:  rc.RemoteId,
+		Type:      channel.Type,
+	}
+	if _, err := scs.server.GetStore().SharedChannel().Save(sc); err != nil {
+		return fmt.Errorf("cannot save shared channel for invite `%s`: %w", invitation.ChannelId, err)
+	}
+
+	scr := &model.SharedChannelRemote{
+		ChannelId: channel.Id,
+		CreatorId: rc.CreatorId,
+		RemoteId:  rc.RemoteId,
+	}
+	if _, err := scs.server.GetStore().SharedChannel().SaveRemote(scr); err != nil {
+		return fmt.Errorf("cannot save shared channel remote for invite `%s`: %w", invitation.ChannelId, err)
+	}
+
+	return nil
+}
+
+// applyModerationPatch applies an invitation's structured Moderation
+// profile to channel, translating it directly into a
+// PatchChannelModerationsForChannel call since the wire format already
+// mirrors model.ChannelModerationPatch.
+func (scs *Service) applyModerationPatch(channel *model.Channel, invitation *channelInviteMsg) error {
+	if _, appErr := scs.app.PatchChannelModerationsForChannel(channel, invitation.Moderation); appErr != nil {
+		return fmt.Errorf("cannot apply channel moderation `%s`: %w", invitation.ChannelId, appErr)
+	}
+
+	return nil
+}
+
+// makeChannelReadOnly disables posting and reacting for members and guests
+// on the given channel.
+func (scs *Service) makeChannelReadOnly(channel *model.Channel, invitation *channelInviteMsg) error {
+	createPostPermission := model.ChannelModeratedPermissionsMap[model.PERMISSION_CREATE_POST.Id]
+	createReactionPermission := model.ChannelModeratedPermissionsMap[model.PERMISSION_ADD_REACTION.Id]
+	updateMap := model.ChannelModeratedRolesPatch{
+		Guests:  model.NewBool(false),
+		Members: model.NewBool(false),
+	}
+
+	patch := []*model.ChannelModerationPatch{
+		{
+			Name:  &createPostPermission,
+			Roles: &updateMap,
+		},
+		{
+			Name:  &createReactionPermission,
+			Roles: &updateMap,
+		},
+	}
+
+	if _, appErr := scs.app.PatchChannelModerationsForChannel(channel, patch); appErr != nil {
+		return fmt.Errorf("cannot make channel readonly `%s`: %w", invitation.ChannelId, appErr)
+	}
+
+	return nil
+}
@@ -4,11 +4,13 @@
 package sharedchannel
 
 import (
+	"crypto/ed25519"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -25,16 +27,46 @@ type mockLogger struct {
 
 func (ml *mockLogger) Log(level mlog.LogLevel, s string, flds ...mlog.Field) {}
 
+func newTestService(server ServerIface, app AppIface) *Service {
+	return &Service{
+		server:     server,
+		app:        app,
+		keyStore:   newMemoryInviteKeyStore(),
+		seenNonces: make(map[string]time.Time),
+		policy:     autoAcceptPolicy{},
+		pending:    newMemoryPendingInvitationStore(),
+		dedupe:     newMemoryInvitationDedupeStore(),
+	}
+}
+
+// signTestInvitation marshals invitation, registers a fresh signing key for
+// remoteClusterId and returns the signed envelope bytes ready to be used as
+// a model.RemoteClusterMsg payload.
+func signTestInvitation(t *testing.T, scs *Service, remoteClusterId string, invitation channelInviteMsg) []byte {
+	t.Helper()
+
+	payload, err := json.Marshal(invitation)
+	require.NoError(t, err)
+
+	keyId, _, privateKey, err := scs.keyStore.RotateKey(remoteClusterId)
+	require.NoError(t, err)
+
+	envelope, err := scs.signInvitation(remoteClusterId, keyId, privateKey, payload)
+	require.NoError(t, err)
+
+	envelopeBytes, err := json.Marshal(envelope)
+	require.NoError(t, err)
+
+	return envelopeBytes
+}
+
 func TestOnReceiveChannelInvite(t *testing.T) {
 	t.Run("when msg payload is empty, it does nothing", func(t *testing.T) {
 		mockServer := &MockServerIface{}
 		mockLogger := &mockLogger{}
 		mockServer.On("GetLogger").Return(mockLogger)
 		mockApp := &MockAppIface{}
-		scs := &Service{
-			server: mockServer,
-			app:    mockApp,
-		}
+		scs := newTestService(mockServer, mockApp)
 
 		mockStore := &mocks.Store{}
 		mockServer = scs.server.(*MockServerIface)
@@ -53,21 +85,17 @@ func TestOnReceiveChannelInvite(t *testing.T) {
 		mockLogger := &mockLogger{}
 		mockServer.On("GetLogger").Return(mockLogger)
 		mockApp := &MockAppIface{}
-		scs := &Service{
-			server: mockServer,
-			app:    mockApp,
-		}
+		scs := newTestService(mockServer, mockApp)
 
 		mockStore := &mocks.Store{}
-		remoteCluster := &model.RemoteCluster{DisplayName: "test"}
+		remoteCluster := &model.RemoteCluster{DisplayName: "test", RemoteId: model.NewId()}
 		invitation := channelInviteMsg{
 			ChannelId: model.NewId(),
 			TeamId:    model.NewId(),
 			ReadOnly:  true,
 			Type:      "0",
 		}
-		payload, err := json.Marshal(invitation)
-		require.NoError(t, err)
+		payload := signTestInvitation(t, scs, remoteCluster.RemoteId, invitation)
 
 		msg := model.RemoteClusterMsg{
 			Payload: payload,
@@ -104,7 +132,7 @@ func TestOnReceiveChannelInvite(t *testing.T) {
 		mockApp.On("PatchChannelModerationsForChannel", channel, readonlyChannelModerations).Return(nil, nil)
 		defer mockApp.AssertExpectations(t)
 
-		err = scs.onReceiveChannelInvite(msg, remoteCluster, nil)
+		err := scs.onReceiveChannelInvite(msg, remoteCluster, nil)
 		require.NoError(t, err)
 	})
 
@@ -113,21 +141,17 @@ func TestOnReceiveChannelInvite(t *testing.T) {
 		mockLogger := &mockLogger{}
 		mockServer.On("GetLogger").Return(mockLogger)
 		mockApp := &MockAppIface{}
-		scs := &Service{
-			server: mockServer,
-			app:    mockApp,
-		}
+		scs := newTestService(mockServer, mockApp)
 
 		mockStore := &mocks.Store{}
-		remoteCluster := &model.RemoteCluster{DisplayName: "test"}
+		remoteCluster := &model.RemoteCluster{DisplayName: "test", RemoteId: model.NewId()}
 		invitation := channelInviteMsg{
 			ChannelId: model.NewId(),
 			TeamId:    model.NewId(),
 			ReadOnly:  true,
 			Type:      "0",
 		}
-		payload, err := json.Marshal(invitation)
-		require.NoError(t, err)
+		payload := signTestInvitation(t, scs, remoteCluster.RemoteId, invitation)
 
 		msg := model.RemoteClusterMsg{
 			Payload: payload,
@@ -145,7 +169,7 @@ func TestOnReceiveChannelInvite(t *testing.T) {
 		mockApp.On("PatchChannelModerationsForChannel", channel, mock.Anything).Return(nil, appErr)
 		defer mockApp.AssertExpectations(t)
 
-		err = scs.onReceiveChannelInvite(msg, remoteCluster, nil)
+		err := scs.onReceiveChannelInvite(msg, remoteCluster, nil)
 		require.Error(t, err)
 		assert.Equal(t, fmt.Sprintf("cannot make channel readonly `%s`: foo: bar, boom", invitation.ChannelId), err.Error())
 	})
@@ -155,13 +179,10 @@ func TestOnReceiveChannelInvite(t *testing.T) {
 		mockLogger := &mockLogger{}
 		mockServer.On("GetLogger").Return(mockLogger)
 		mockApp := &MockAppIface{}
-		scs := &Service{
-			server: mockServer,
-			app:    mockApp,
-		}
+		scs := newTestService(mockServer, mockApp)
 
 		mockStore := &mocks.Store{}
-		remoteCluster := &model.RemoteCluster{DisplayName: "test", CreatorId: model.NewId()}
+		remoteCluster := &model.RemoteCluster{DisplayName: "test", RemoteId: model.NewId(), CreatorId: model.NewId()}
 		invitation := channelInviteMsg{
 			ChannelId:            model.NewId(),
 			TeamId:               model.NewId(),
@@ -169,8 +190,7 @@ func TestOnReceiveChannelInvite(t *testing.T) {
 			Type:                 model.CHANNEL_DIRECT,
 			DirectParticipantIDs: []string{model.NewId(), model.NewId()},
 		}
-		payload, err := json.Marshal(invitation)
-		require.NoError(t, err)
+		payload := signTestInvitation(t, scs, remoteCluster.RemoteId, invitation)
 
 		msg := model.RemoteClusterMsg{
 			Payload: payload,
@@ -191,7 +211,176 @@ func TestOnReceiveChannelInvite(t *testing.T) {
 		mockApp.On("GetOrCreateDirectChannel", invitation.DirectParticipantIDs[0], invitation.DirectParticipantIDs[1], mock.AnythingOfType("model.ChannelOption")).Return(channel, nil)
 		defer mockApp.AssertExpectations(t)
 
-		err = scs.onReceiveChannelInvite(msg, remoteCluster, nil)
+		err := scs.onReceiveChannelInvite(msg, remoteCluster, nil)
+		require.NoError(t, err)
+	})
+
+	t.Run("when invitation prescribes a group channel, it does create a group channel", func(t *testing.T) {
+		mockServer := &MockServerIface{}
+		mockLogger := &mockLogger{}
+		mockServer.On("GetLogger").Return(mockLogger)
+		mockApp := &MockAppIface{}
+		scs := newTestService(mockServer, mockApp)
+
+		mockStore := &mocks.Store{}
+		remoteCluster := &model.RemoteCluster{DisplayName: "test", RemoteId: model.NewId(), CreatorId: model.NewId()}
+		invitation := channelInviteMsg{
+			ChannelId:            model.NewId(),
+			TeamId:               model.NewId(),
+			ReadOnly:             false,
+			Type:                 model.CHANNEL_GROUP,
+			DirectParticipantIDs: []string{model.NewId(), model.NewId(), model.NewId()},
+		}
+		payload := signTestInvitation(t, scs, remoteCluster.RemoteId, invitation)
+
+		msg := model.RemoteClusterMsg{
+			Payload: payload,
+		}
+		mockChannelStore := mocks.ChannelStore{}
+		mockSharedChannelStore := mocks.SharedChannelStore{}
+		channel := &model.Channel{}
+
+		mockChannelStore.On("Get", invitation.ChannelId, true).Return(nil, errors.New("boom"))
+		mockSharedChannelStore.On("Save", mock.Anything).Return(nil, nil)
+		mockSharedChannelStore.On("SaveRemote", mock.Anything).Return(nil, nil)
+		mockStore.On("Channel").Return(&mockChannelStore)
+		mockStore.On("SharedChannel").Return(&mockSharedChannelStore)
+
+		mockServer = scs.server.(*MockServerIface)
+		mockServer.On("GetStore").Return(mockStore)
+
+		mockApp.On("GetOrCreateGroupChannel", invitation.DirectParticipantIDs).Return(channel, nil)
+		defer mockApp.AssertExpectations(t)
+
+		err := scs.onReceiveChannelInvite(msg, remoteCluster, nil)
+		require.NoError(t, err)
+	})
+
+	t.Run("when invitation payload has been tampered with, it returns an error", func(t *testing.T) {
+		mockServer := &MockServerIface{}
+		mockLogger := &mockLogger{}
+		mockServer.On("GetLogger").Return(mockLogger)
+		mockApp := &MockAppIface{}
+		scs := newTestService(mockServer, mockApp)
+
+		mockStore := &mocks.Store{}
+		mockServer = scs.server.(*MockServerIface)
+		mockServer.On("GetStore").Return(mockStore)
+
+		remoteCluster := &model.RemoteCluster{DisplayName: "test", RemoteId: model.NewId()}
+		invitation := channelInviteMsg{ChannelId: model.NewId(), TeamId: model.NewId(), Type: "0"}
+		payload := signTestInvitation(t, scs, remoteCluster.RemoteId, invitation)
+
+		var envelope signedInviteEnvelope
+		require.NoError(t, json.Unmarshal(payload, &envelope))
+		envelope.Payload = append(envelope.Payload, []byte("tampered")...)
+		tampered, err := json.Marshal(envelope)
 		require.NoError(t, err)
+
+		err = scs.onReceiveChannelInvite(model.RemoteClusterMsg{Payload: tampered}, remoteCluster, nil)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "invalid signature")
+		mockStore.AssertNotCalled(t, "Channel")
+	})
+
+	t.Run("when invitation is signed with an unregistered key, it returns an error", func(t *testing.T) {
+		mockServer := &MockServerIface{}
+		mockLogger := &mockLogger{}
+		mockServer.On("GetLogger").Return(mockLogger)
+		mockApp := &MockAppIface{}
+		scs := newTestService(mockServer, mockApp)
+
+		mockStore := &mocks.Store{}
+		mockServer = scs.server.(*MockServerIface)
+		mockServer.On("GetStore").Return(mockStore)
+
+		remoteCluster := &model.RemoteCluster{DisplayName: "test", RemoteId: model.NewId()}
+		invitation := channelInviteMsg{ChannelId: model.NewId(), TeamId: model.NewId(), Type: "0"}
+		payload, err := json.Marshal(invitation)
+		require.NoError(t, err)
+
+		_, forgedPublic, forgedPrivate, err := ed25519.GenerateKey(nil)
+		require.NoError(t, err)
+		_ = forgedPublic
+
+		envelope, err := scs.signInvitation(remoteCluster.RemoteId, model.NewId(), forgedPrivate, payload)
+		require.NoError(t, err)
+		envelopeBytes, err := json.Marshal(envelope)
+		require.NoError(t, err)
+
+		err = scs.onReceiveChannelInvite(model.RemoteClusterMsg{Payload: envelopeBytes}, remoteCluster, nil)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "unknown signing key")
+		mockStore.AssertNotCalled(t, "Channel")
+	})
+
+	t.Run("when invitation timestamp is expired, it returns an error", func(t *testing.T) {
+		mockServer := &MockServerIface{}
+		mockLogger := &mockLogger{}
+		mockServer.On("GetLogger").Return(mockLogger)
+		mockApp := &MockAppIface{}
+		scs := newTestService(mockServer, mockApp)
+
+		mockStore := &mocks.Store{}
+		mockServer = scs.server.(*MockServerIface)
+		mockServer.On("GetStore").Return(mockStore)
+
+		remoteCluster := &model.RemoteCluster{DisplayName: "test", RemoteId: model.NewId()}
+		invitation := channelInviteMsg{ChannelId: model.NewId(), TeamId: model.NewId(), Type: "0"}
+		payload, err := json.Marshal(invitation)
+		require.NoError(t, err)
+
+		keyId, _, privateKey, err := scs.keyStore.RotateKey(remoteCluster.RemoteId)
+		require.NoError(t, err)
+
+		envelope := &signedInviteEnvelope{
+			Payload:   payload,
+			KeyId:     keyId,
+			Timestamp: time.Now().Add(-inviteMaxClockSkew * 2).Unix(),
+			Nonce:     model.NewId(),
+		}
+		envelope.Signature = ed25519.Sign(privateKey, inviteSigningInput(envelope))
+
+		envelopeBytes, err := json.Marshal(envelope)
+		require.NoError(t, err)
+
+		err = scs.onReceiveChannelInvite(model.RemoteClusterMsg{Payload: envelopeBytes}, remoteCluster, nil)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "clock skew")
+		mockStore.AssertNotCalled(t, "Channel")
+	})
+
+	t.Run("when invitation nonce is replayed, it returns an error on the second delivery", func(t *testing.T) {
+		mockServer := &MockServerIface{}
+		mockLogger := &mockLogger{}
+		mockServer.On("GetLogger").Return(mockLogger)
+		mockApp := &MockAppIface{}
+		scs := newTestService(mockServer, mockApp)
+
+		mockStore := &mocks.Store{}
+		remoteCluster := &model.RemoteCluster{DisplayName: "test", RemoteId: model.NewId()}
+		invitation := channelInviteMsg{ChannelId: model.NewId(), TeamId: model.NewId(), ReadOnly: true, Type: "0"}
+		payload := signTestInvitation(t, scs, remoteCluster.RemoteId, invitation)
+
+		mockChannelStore := mocks.ChannelStore{}
+		mockSharedChannelStore := mocks.SharedChannelStore{}
+		channel := &model.Channel{}
+
+		mockChannelStore.On("Get", invitation.ChannelId, true).Return(channel, nil)
+		mockStore.On("Channel").Return(&mockChannelStore)
+		mockStore.On("SharedChannel").Return(&mockSharedChannelStore)
+
+		mockServer = scs.server.(*MockServerIface)
+		mockServer.On("GetStore").Return(mockStore)
+		mockApp.On("PatchChannelModerationsForChannel", channel, mock.Anything).Return(nil, nil)
+
+		msg := model.RemoteClusterMsg{Payload: payload}
+
+		err := scs.onReceiveChannelInvite(msg, remoteCluster, nil)
+		require.NoError(t, err)
+
+		err = scs.onReceiveChannelInvite(msg, remoteCluster, nil)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "duplicate nonce")
 	})
 }
@@ -0,0 +1,184 @@
+// Copyright (c) 2015-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package sharedchannel
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest/mock"
+	"github.com/mattermost/mattermost-server/v5/store/storetest/mocks"
+)
+
+func TestOnReceiveChannelInviteWithModerationProfile(t *testing.T) {
+	t.Run("reactions allowed but posts disabled for guests only", func(t *testing.T) {
+		mockServer := &MockServerIface{}
+		mockServer.On("GetLogger").Return(&mockLogger{})
+		mockApp := &MockAppIface{}
+		scs := newTestService(mockServer, mockApp)
+
+		remoteCluster := &model.RemoteCluster{DisplayName: "test", RemoteId: model.NewId()}
+		createPostPermission := model.ChannelModeratedPermissionsMap[model.PERMISSION_CREATE_POST.Id]
+		moderation := []*model.ChannelModerationPatch{
+			{
+				Name: &createPostPermission,
+				Roles: &model.ChannelModeratedRolesPatch{
+					Guests:  model.NewBool(false),
+					Members: model.NewBool(true),
+				},
+			},
+		}
+		invitation := channelInviteMsg{
+			ChannelId:  model.NewId(),
+			TeamId:     model.NewId(),
+			Type:       "0",
+			ReadOnly:   true,
+			Moderation: moderation,
+		}
+		payload := signTestInvitation(t, scs, remoteCluster.RemoteId, invitation)
+
+		mockStore := &mocks.Store{}
+		mockChannelStore := mocks.ChannelStore{}
+		channel := &model.Channel{}
+		mockChannelStore.On("Get", invitation.ChannelId, true).Return(channel, nil)
+		mockStore.On("Channel").Return(&mockChannelStore)
+		mockServer.On("GetStore").Return(mockStore)
+
+		mockApp.On("PatchChannelModerationsForChannel", channel, moderation).Return(nil, nil)
+		defer mockApp.AssertExpectations(t)
+
+		err := scs.onReceiveChannelInvite(model.RemoteClusterMsg{Payload: payload}, remoteCluster, nil)
+		require.NoError(t, err)
+	})
+
+	t.Run("guests fully muted while members read and write, channel mentions disabled", func(t *testing.T) {
+		mockServer := &MockServerIface{}
+		mockServer.On("GetLogger").Return(&mockLogger{})
+		mockApp := &MockAppIface{}
+		scs := newTestService(mockServer, mockApp)
+
+		remoteCluster := &model.RemoteCluster{DisplayName: "test", RemoteId: model.NewId()}
+		createPostPermission := model.ChannelModeratedPermissionsMap[model.PERMISSION_CREATE_POST.Id]
+		createReactionPermission := model.ChannelModeratedPermissionsMap[model.PERMISSION_ADD_REACTION.Id]
+		useChannelMentionsPermission := model.ChannelModeratedPermissionsMap[model.PERMISSION_USE_CHANNEL_MENTIONS.Id]
+		moderation := []*model.ChannelModerationPatch{
+			{
+				Name: &createPostPermission,
+				Roles: &model.ChannelModeratedRolesPatch{
+					Guests:  model.NewBool(false),
+					Members: model.NewBool(true),
+				},
+			},
+			{
+				Name: &createReactionPermission,
+				Roles: &model.ChannelModeratedRolesPatch{
+					Guests:  model.NewBool(false),
+					Members: model.NewBool(true),
+				},
+			},
+			{
+				Name: &useChannelMentionsPermission,
+				Roles: &model.ChannelModeratedRolesPatch{
+					Guests:  model.NewBool(false),
+					Members: model.NewBool(false),
+				},
+			},
+		}
+		invitation := channelInviteMsg{
+			ChannelId:  model.NewId(),
+			TeamId:     model.NewId(),
+			Type:       "0",
+			Moderation: moderation,
+		}
+		payload := signTestInvitation(t, scs, remoteCluster.RemoteId, invitation)
+
+		mockStore := &mocks.Store{}
+		mockChannelStore := mocks.ChannelStore{}
+		channel := &model.Channel{}
+		mockChannelStore.On("Get", invitation.ChannelId, true).Return(channel, nil)
+		mockStore.On("Channel").Return(&mockChannelStore)
+		mockServer.On("GetStore").Return(mockStore)
+
+		mockApp.On("PatchChannelModerationsForChannel", channel, moderation).Return(nil, nil)
+		defer mockApp.AssertExpectations(t)
+
+		err := scs.onReceiveChannelInvite(model.RemoteClusterMsg{Payload: payload}, remoteCluster, nil)
+		require.NoError(t, err)
+	})
+
+	t.Run("when moderation profile is absent, ReadOnly remains a working shortcut", func(t *testing.T) {
+		mockServer := &MockServerIface{}
+		mockServer.On("GetLogger").Return(&mockLogger{})
+		mockApp := &MockAppIface{}
+		scs := newTestService(mockServer, mockApp)
+
+		remoteCluster := &model.RemoteCluster{DisplayName: "test", RemoteId: model.NewId()}
+		invitation := channelInviteMsg{
+			ChannelId: model.NewId(),
+			TeamId:    model.NewId(),
+			Type:      "0",
+			ReadOnly:  true,
+		}
+		payload := signTestInvitation(t, scs, remoteCluster.RemoteId, invitation)
+
+		mockStore := &mocks.Store{}
+		mockChannelStore := mocks.ChannelStore{}
+		channel := &model.Channel{}
+		mockChannelStore.On("Get", invitation.ChannelId, true).Return(channel, nil)
+		mockStore.On("Channel").Return(&mockChannelStore)
+		mockServer.On("GetStore").Return(mockStore)
+
+		mockApp.On("PatchChannelModerationsForChannel", channel, mock.Anything).Return(nil, nil)
+		defer mockApp.AssertExpectations(t)
+
+		err := scs.onReceiveChannelInvite(model.RemoteClusterMsg{Payload: payload}, remoteCluster, nil)
+		require.NoError(t, err)
+	})
+
+	t.Run("when moderation patch fails, it returns an error preserving the wrapping format", func(t *testing.T) {
+		mockServer := &MockServerIface{}
+		mockServer.On("GetLogger").Return(&mockLogger{})
+		mockApp := &MockAppIface{}
+		scs := newTestService(mockServer, mockApp)
+
+		remoteCluster := &model.RemoteCluster{DisplayName: "test", RemoteId: model.NewId()}
+		createPostPermission := model.ChannelModeratedPermissionsMap[model.PERMISSION_CREATE_POST.Id]
+		moderation := []*model.ChannelModerationPatch{
+			{
+				Name: &createPostPermission,
+				Roles: &model.ChannelModeratedRolesPatch{
+					Guests:  model.NewBool(false),
+					Members: model.NewBool(false),
+				},
+			},
+		}
+		invitation := channelInviteMsg{
+			ChannelId:  model.NewId(),
+			TeamId:     model.NewId(),
+			Type:       "0",
+			Moderation: moderation,
+		}
+		payload := signTestInvitation(t, scs, remoteCluster.RemoteId, invitation)
+
+		mockStore := &mocks.Store{}
+		mockChannelStore := mocks.ChannelStore{}
+		channel := &model.Channel{}
+		mockChannelStore.On("Get", invitation.ChannelId, true).Return(channel, nil)
+		mockStore.On("Channel").Return(&mockChannelStore)
+		mockServer.On("GetStore").Return(mockStore)
+
+		appErr := model.NewAppError("foo", "bar", nil, "boom", http.StatusBadRequest)
+		mockApp.On("PatchChannelModerationsForChannel", channel, moderation).Return(nil, appErr)
+		defer mockApp.AssertExpectations(t)
+
+		err := scs.onReceiveChannelInvite(model.RemoteClusterMsg{Payload: payload}, remoteCluster, nil)
+		require.Error(t, err)
+		assert.Equal(t, fmt.Sprintf("cannot apply channel moderation `%s`: foo: bar, boom", invitation.ChannelId), err.Error())
+	})
+}
@@ -0,0 +1,53 @@
+// Copyright (c) 2015-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package sharedchannel
+
+import (
+	"fmt"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+// ListPendingInvitations returns every invitation currently awaiting admin
+// approval or rejection. It is meant to back an admin `GET` endpoint for
+// pending shared channel invitations, but no such HTTP route exists yet;
+// today this is reachable only by calling the Service method directly.
+func (scs *Service) ListPendingInvitations() ([]*PendingInvitation, error) {
+	return scs.pending.List()
+}
+
+// ApproveInvitation accepts a previously deferred invitation, running the
+// same channel creation and sharing path that AutoAccept would have run
+// immediately. It is meant to back an admin `POST .../approve` endpoint,
+// but no such HTTP route exists yet; today this is reachable only by
+// calling the Service method directly.
+func (scs *Service) ApproveInvitation(id string) error {
+	pending, err := scs.pending.Get(id)
+	if err != nil {
+		return fmt.Errorf("cannot approve invitation `%s`: %w", id, err)
+	}
+
+	rc := &model.RemoteCluster{RemoteId: pending.RemoteClusterId, CreatorId: pending.RemoteClusterCreatorId}
+	if err = scs.acceptInvitation(rc, &pending.Invitation); err != nil {
+		return fmt.Errorf("cannot approve invitation `%s`: %w", id, err)
+	}
+
+	if _, err = scs.pending.UpdateStatus(id, PendingInvitationStatusApproved); err != nil {
+		return fmt.Errorf("cannot approve invitation `%s`: %w", id, err)
+	}
+
+	return nil
+}
+
+// RejectInvitation marks a previously deferred invitation as rejected
+// without creating or sharing the channel. It is meant to back an admin
+// `POST .../reject` endpoint, but no such HTTP route exists yet; today
+// this is reachable only by calling the Service method directly.
+func (scs *Service) RejectInvitation(id string) error {
+	if _, err := scs.pending.UpdateStatus(id, PendingInvitationStatusRejected); err != nil {
+		return fmt.Errorf("cannot reject invitation `%s`: %w", id, err)
+	}
+
+	return nil
+}
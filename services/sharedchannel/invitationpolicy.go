@@ -0,0 +1,82 @@
+// Copyright (c) 2015-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package sharedchannel
+
+import (
+	"fmt"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+// InvitationPolicyMode names one of the built-in InvitationPolicy
+// implementations. Nothing in this package reads config yet: a server
+// wires one of these modes onto a Service by calling NewInvitationPolicy
+// and Service.SetInvitationPolicy itself; exposing a mode through
+// model.ClusterSettings so it can be changed from the System Console is
+// left for a follow-up.
+type InvitationPolicyMode string
+
+const (
+	// InvitationPolicyAutoAccept accepts every invitation immediately. This
+	// is the historical behavior and remains the default.
+	InvitationPolicyAutoAccept InvitationPolicyMode = "auto_accept"
+	// InvitationPolicyAllowlistRemotes accepts invitations immediately only
+	// from remote clusters explicitly allowlisted by an admin; invitations
+	// from any other remote cluster are deferred as pending.
+	InvitationPolicyAllowlistRemotes InvitationPolicyMode = "allowlist_remotes"
+	// InvitationPolicyRequireAdminApproval defers every invitation until an
+	// admin approves it via the pending invitations API.
+	InvitationPolicyRequireAdminApproval InvitationPolicyMode = "require_admin_approval"
+)
+
+// InvitationPolicy decides whether an incoming channel invitation should be
+// accepted immediately. When Evaluate returns false, the invitation is
+// stored as pending instead of being acted upon.
+type InvitationPolicy interface {
+	Evaluate(rc *model.RemoteCluster, invitation *channelInviteMsg) bool
+}
+
+// NewInvitationPolicy builds the InvitationPolicy for the given mode. For
+// InvitationPolicyAllowlistRemotes, allowedRemoteIds lists the remote
+// cluster ids permitted to auto-accept; it is ignored for other modes.
+func NewInvitationPolicy(mode InvitationPolicyMode, allowedRemoteIds []string) (InvitationPolicy, error) {
+	switch mode {
+	case "", InvitationPolicyAutoAccept:
+		return autoAcceptPolicy{}, nil
+	case InvitationPolicyAllowlistRemotes:
+		return newAllowlistRemotesPolicy(allowedRemoteIds), nil
+	case InvitationPolicyRequireAdminApproval:
+		return requireAdminApprovalPolicy{}, nil
+	default:
+		return nil, fmt.Errorf("unknown invitation policy mode `%s`", mode)
+	}
+}
+
+type autoAcceptPolicy struct{}
+
+func (autoAcceptPolicy) Evaluate(*model.RemoteCluster, *channelInviteMsg) bool {
+	return true
+}
+
+type requireAdminApprovalPolicy struct{}
+
+func (requireAdminApprovalPolicy) Evaluate(*model.RemoteCluster, *channelInviteMsg) bool {
+	return false
+}
+
+type allowlistRemotesPolicy struct {
+	allowed map[string]bool
+}
+
+func newAllowlistRemotesPolicy(allowedRemoteIds []string) *allowlistRemotesPolicy {
+	allowed := make(map[string]bool, len(allowedRemoteIds))
+	for _, id := range allowedRemoteIds {
+		allowed[id] = true
+	}
+	return &allowlistRemotesPolicy{allowed: allowed}
+}
+
+func (p *allowlistRemotesPolicy) Evaluate(rc *model.RemoteCluster, _ *channelInviteMsg) bool {
+	return p.allowed[rc.RemoteId]
+}
@@ -0,0 +1,180 @@
+// Copyright (c) 2015-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package sharedchannel
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest/mock"
+	"github.com/mattermost/mattermost-server/v5/store/storetest/mocks"
+)
+
+func TestOnReceiveChannelInviteWithPolicy(t *testing.T) {
+	t.Run("auto accept policy creates the channel immediately", func(t *testing.T) {
+		mockServer := &MockServerIface{}
+		mockServer.On("GetLogger").Return(&mockLogger{})
+		mockApp := &MockAppIface{}
+		scs := newTestService(mockServer, mockApp)
+		policy, err := NewInvitationPolicy(InvitationPolicyAutoAccept, nil)
+		require.NoError(t, err)
+		scs.SetInvitationPolicy(policy)
+
+		remoteCluster := &model.RemoteCluster{DisplayName: "test", RemoteId: model.NewId(), CreatorId: model.NewId()}
+		invitation := channelInviteMsg{
+			ChannelId:            model.NewId(),
+			TeamId:               model.NewId(),
+			Type:                 model.CHANNEL_DIRECT,
+			DirectParticipantIDs: []string{model.NewId(), model.NewId()},
+		}
+		payload := signTestInvitation(t, scs, remoteCluster.RemoteId, invitation)
+
+		mockStore := &mocks.Store{}
+		mockChannelStore := mocks.ChannelStore{}
+		mockSharedChannelStore := mocks.SharedChannelStore{}
+		channel := &model.Channel{}
+
+		mockChannelStore.On("Get", invitation.ChannelId, true).Return(nil, errors.New("boom"))
+		mockSharedChannelStore.On("Save", mock.Anything).Return(nil, nil)
+		mockSharedChannelStore.On("SaveRemote", mock.Anything).Return(nil, nil)
+		mockStore.On("Channel").Return(&mockChannelStore)
+		mockStore.On("SharedChannel").Return(&mockSharedChannelStore)
+		mockServer.On("GetStore").Return(mockStore)
+
+		mockApp.On("GetOrCreateDirectChannel", invitation.DirectParticipantIDs[0], invitation.DirectParticipantIDs[1], mock.AnythingOfType("model.ChannelOption")).Return(channel, nil)
+		defer mockApp.AssertExpectations(t)
+
+		err = scs.onReceiveChannelInvite(model.RemoteClusterMsg{Payload: payload}, remoteCluster, nil)
+		require.NoError(t, err)
+
+		pending, listErr := scs.ListPendingInvitations()
+		require.NoError(t, listErr)
+		require.Empty(t, pending)
+	})
+
+	t.Run("allowlist remotes policy defers a remote not on the list", func(t *testing.T) {
+		mockServer := &MockServerIface{}
+		mockServer.On("GetLogger").Return(&mockLogger{})
+		mockApp := &MockAppIface{}
+		scs := newTestService(mockServer, mockApp)
+		policy, err := NewInvitationPolicy(InvitationPolicyAllowlistRemotes, []string{model.NewId()})
+		require.NoError(t, err)
+		scs.SetInvitationPolicy(policy)
+
+		remoteCluster := &model.RemoteCluster{DisplayName: "test", RemoteId: model.NewId()}
+		invitation := channelInviteMsg{ChannelId: model.NewId(), TeamId: model.NewId(), Type: "0"}
+		payload := signTestInvitation(t, scs, remoteCluster.RemoteId, invitation)
+
+		mockStore := &mocks.Store{}
+		mockServer.On("GetStore").Return(mockStore)
+
+		err = scs.onReceiveChannelInvite(model.RemoteClusterMsg{Payload: payload}, remoteCluster, nil)
+		require.NoError(t, err)
+		mockStore.AssertNotCalled(t, "Channel")
+
+		pending, err := scs.ListPendingInvitations()
+		require.NoError(t, err)
+		require.Len(t, pending, 1)
+		require.Equal(t, PendingInvitationStatusPending, pending[0].Status)
+	})
+
+	t.Run("allowlist remotes policy accepts a remote on the list", func(t *testing.T) {
+		mockServer := &MockServerIface{}
+		mockServer.On("GetLogger").Return(&mockLogger{})
+		mockApp := &MockAppIface{}
+		scs := newTestService(mockServer, mockApp)
+
+		remoteCluster := &model.RemoteCluster{DisplayName: "test", RemoteId: model.NewId()}
+		policy, err := NewInvitationPolicy(InvitationPolicyAllowlistRemotes, []string{remoteCluster.RemoteId})
+		require.NoError(t, err)
+		scs.SetInvitationPolicy(policy)
+
+		invitation := channelInviteMsg{ChannelId: model.NewId(), TeamId: model.NewId(), ReadOnly: true, Type: "0"}
+		payload := signTestInvitation(t, scs, remoteCluster.RemoteId, invitation)
+
+		mockStore := &mocks.Store{}
+		mockChannelStore := mocks.ChannelStore{}
+		channel := &model.Channel{}
+		mockChannelStore.On("Get", invitation.ChannelId, true).Return(channel, nil)
+		mockStore.On("Channel").Return(&mockChannelStore)
+		mockServer.On("GetStore").Return(mockStore)
+		mockApp.On("PatchChannelModerationsForChannel", channel, mock.Anything).Return(nil, nil)
+		defer mockApp.AssertExpectations(t)
+
+		err = scs.onReceiveChannelInvite(model.RemoteClusterMsg{Payload: payload}, remoteCluster, nil)
+		require.NoError(t, err)
+	})
+
+	t.Run("require admin approval policy defers the invitation until approved", func(t *testing.T) {
+		mockServer := &MockServerIface{}
+		mockServer.On("GetLogger").Return(&mockLogger{})
+		mockApp := &MockAppIface{}
+		scs := newTestService(mockServer, mockApp)
+		policy, err := NewInvitationPolicy(InvitationPolicyRequireAdminApproval, nil)
+		require.NoError(t, err)
+		scs.SetInvitationPolicy(policy)
+
+		remoteCluster := &model.RemoteCluster{DisplayName: "test", RemoteId: model.NewId()}
+		invitation := channelInviteMsg{ChannelId: model.NewId(), TeamId: model.NewId(), ReadOnly: true, Type: "0"}
+		payload := signTestInvitation(t, scs, remoteCluster.RemoteId, invitation)
+
+		mockStore := &mocks.Store{}
+		mockServer.On("GetStore").Return(mockStore)
+
+		err = scs.onReceiveChannelInvite(model.RemoteClusterMsg{Payload: payload}, remoteCluster, nil)
+		require.NoError(t, err)
+		mockStore.AssertNotCalled(t, "Channel")
+
+		pending, err := scs.ListPendingInvitations()
+		require.NoError(t, err)
+		require.Len(t, pending, 1)
+
+		mockChannelStore := mocks.ChannelStore{}
+		channel := &model.Channel{}
+		mockChannelStore.On("Get", invitation.ChannelId, true).Return(channel, nil)
+		mockStore.On("Channel").Return(&mockChannelStore)
+		mockApp.On("PatchChannelModerationsForChannel", channel, mock.Anything).Return(nil, nil)
+		defer mockApp.AssertExpectations(t)
+
+		require.NoError(t, scs.ApproveInvitation(pending[0].Id))
+
+		approved, err := scs.ListPendingInvitations()
+		require.NoError(t, err)
+		require.Equal(t, PendingInvitationStatusApproved, approved[0].Status)
+	})
+
+	t.Run("rejecting a deferred invitation never creates the channel", func(t *testing.T) {
+		mockServer := &MockServerIface{}
+		mockServer.On("GetLogger").Return(&mockLogger{})
+		mockApp := &MockAppIface{}
+		scs := newTestService(mockServer, mockApp)
+		policy, err := NewInvitationPolicy(InvitationPolicyRequireAdminApproval, nil)
+		require.NoError(t, err)
+		scs.SetInvitationPolicy(policy)
+
+		remoteCluster := &model.RemoteCluster{DisplayName: "test", RemoteId: model.NewId()}
+		invitation := channelInviteMsg{ChannelId: model.NewId(), TeamId: model.NewId(), Type: "0"}
+		payload := signTestInvitation(t, scs, remoteCluster.RemoteId, invitation)
+
+		mockStore := &mocks.Store{}
+		mockServer.On("GetStore").Return(mockStore)
+
+		err = scs.onReceiveChannelInvite(model.RemoteClusterMsg{Payload: payload}, remoteCluster, nil)
+		require.NoError(t, err)
+
+		pending, err := scs.ListPendingInvitations()
+		require.NoError(t, err)
+		require.Len(t, pending, 1)
+
+		require.NoError(t, scs.RejectInvitation(pending[0].Id))
+		mockStore.AssertNotCalled(t, "Channel")
+
+		rejected, err := scs.ListPendingInvitations()
+		require.NoError(t, err)
+		require.Equal(t, PendingInvitationStatusRejected, rejected[0].Status)
+	})
+}
@@ -0,0 +1,151 @@
+// Copyright (c) 2015-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package sharedchannel
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/store"
+)
+
+// invitationDedupeTTL bounds how long an invitation id is remembered for
+// idempotency purposes. It is intentionally much longer than
+// inviteNonceTTL, since retransmissions can be retried well after the
+// signing envelope's own freshness window has passed.
+const invitationDedupeTTL = 24 * time.Hour
+
+// InvitationDedupeStore remembers which (remoteClusterId, invitationId)
+// pairs have already been processed, so a retransmitted channelInviteMsg
+// can be short-circuited instead of reapplied. Seen and Record are kept
+// separate, rather than a single check-and-set call, so that a caller only
+// records an invitation once it has actually been acted upon successfully;
+// recording it before that would cause a retry of a failed attempt to be
+// mistaken for a duplicate and silently dropped.
+type InvitationDedupeStore interface {
+	// Seen returns true if the given invitation was already recorded and
+	// is still within its TTL.
+	Seen(remoteClusterId, invitationId string) bool
+
+	// Record remembers the given invitation as processed for
+	// invitationDedupeTTL.
+	Record(remoteClusterId, invitationId string) error
+}
+
+// memoryInvitationDedupeStore is an in-memory InvitationDedupeStore
+// implementation, keeping seen invitation ids for the lifetime of the
+// service. NewSharedChannelService uses storeInvitationDedupeStore instead.
+type memoryInvitationDedupeStore struct {
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+func newMemoryInvitationDedupeStore() *memoryInvitationDedupeStore {
+	return &memoryInvitationDedupeStore{
+		seen: make(map[string]time.Time),
+	}
+}
+
+func invitationDedupeKey(remoteClusterId, invitationId string) string {
+	return remoteClusterId + "/" + invitationId
+}
+
+func (s *memoryInvitationDedupeStore) Seen(remoteClusterId, invitationId string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.evictLocked()
+
+	key := invitationDedupeKey(remoteClusterId, invitationId)
+	seenAt, ok := s.seen[key]
+	return ok && time.Since(seenAt) <= invitationDedupeTTL
+}
+
+func (s *memoryInvitationDedupeStore) Record(remoteClusterId, invitationId string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.evictLocked()
+
+	s.seen[invitationDedupeKey(remoteClusterId, invitationId)] = time.Now()
+
+	return nil
+}
+
+// evictLocked removes entries older than invitationDedupeTTL. Callers must
+// hold s.mu.
+func (s *memoryInvitationDedupeStore) evictLocked() {
+	now := time.Now()
+	for key, seenAt := range s.seen {
+		if now.Sub(seenAt) > invitationDedupeTTL {
+			delete(s.seen, key)
+		}
+	}
+}
+
+// invitationDedupeSystemKeyPrefix namespaces the System store keys used by
+// storeInvitationDedupeStore so they can't collide with unrelated system
+// settings.
+const invitationDedupeSystemKeyPrefix = "SharedChannelInviteDedupe_"
+
+// storeInvitationDedupeStore is an InvitationDedupeStore backed by
+// store.Store().System(), the same key/value table the server already uses
+// for small pieces of durable state. Unlike memoryInvitationDedupeStore,
+// entries survive a restart and are visible to every node handling remote
+// cluster messages for the cluster, which is what lets a retransmission
+// delivered to a different node than the original still be recognized as a
+// duplicate.
+type storeInvitationDedupeStore struct {
+	store store.Store
+}
+
+func newStoreInvitationDedupeStore(store store.Store) *storeInvitationDedupeStore {
+	return &storeInvitationDedupeStore{store: store}
+}
+
+func invitationDedupeSystemKey(remoteClusterId, invitationId string) string {
+	return invitationDedupeSystemKeyPrefix + invitationDedupeKey(remoteClusterId, invitationId)
+}
+
+func (s *storeInvitationDedupeStore) Seen(remoteClusterId, invitationId string) bool {
+	key := invitationDedupeSystemKey(remoteClusterId, invitationId)
+
+	system, err := s.store.System().GetByName(key)
+	if err != nil {
+		return false
+	}
+
+	seenAtMillis, err := strconv.ParseInt(system.Value, 10, 64)
+	if err != nil {
+		return false
+	}
+
+	seenAt := time.Unix(0, seenAtMillis*int64(time.Millisecond))
+	if time.Since(seenAt) > invitationDedupeTTL {
+		// The entry is past its TTL: evict it and report it as unseen so a
+		// legitimate redelivery years later isn't rejected forever.
+		_, _ = s.store.System().PermanentDeleteByName(key)
+		return false
+	}
+
+	return true
+}
+
+func (s *storeInvitationDedupeStore) Record(remoteClusterId, invitationId string) error {
+	key := invitationDedupeSystemKey(remoteClusterId, invitationId)
+	seenAtMillis := time.Now().UnixNano() / int64(time.Millisecond)
+
+	system := &model.System{
+		Name:  key,
+		Value: strconv.FormatInt(seenAtMillis, 10),
+	}
+	if err := s.store.System().SaveOrUpdate(system); err != nil {
+		return fmt.Errorf("cannot record invitation `%s` as seen: %w", invitationId, err)
+	}
+
+	return nil
+}
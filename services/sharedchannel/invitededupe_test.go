@@ -0,0 +1,66 @@
+// Copyright (c) 2015-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package sharedchannel
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin/plugintest/mock"
+	"github.com/mattermost/mattermost-server/v5/store/storetest/mocks"
+)
+
+// TestOnReceiveChannelInviteIsIdempotent exercises a retransmission of the
+// same invitation, re-signed with a fresh envelope (as a remote cluster
+// would do on retry), and asserts that the side effects are only applied
+// once thanks to the InvitationId dedupe cache.
+func TestOnReceiveChannelInviteIsIdempotent(t *testing.T) {
+	mockServer := &MockServerIface{}
+	mockServer.On("GetLogger").Return(&mockLogger{})
+	mockApp := &MockAppIface{}
+	scs := newTestService(mockServer, mockApp)
+
+	remoteCluster := &model.RemoteCluster{DisplayName: "test", RemoteId: model.NewId(), CreatorId: model.NewId()}
+	invitation := channelInviteMsg{
+		ChannelId:            model.NewId(),
+		TeamId:               model.NewId(),
+		ReadOnly:             true,
+		Type:                 model.CHANNEL_DIRECT,
+		DirectParticipantIDs: []string{model.NewId(), model.NewId()},
+		InvitationId:         model.NewId(),
+	}
+
+	mockStore := &mocks.Store{}
+	mockChannelStore := mocks.ChannelStore{}
+	mockSharedChannelStore := mocks.SharedChannelStore{}
+	channel := &model.Channel{}
+
+	mockChannelStore.On("Get", invitation.ChannelId, true).Return(nil, errors.New("boom"))
+	mockSharedChannelStore.On("Save", mock.Anything).Return(nil, nil)
+	mockSharedChannelStore.On("SaveRemote", mock.Anything).Return(nil, nil)
+	mockStore.On("Channel").Return(&mockChannelStore)
+	mockStore.On("SharedChannel").Return(&mockSharedChannelStore)
+	mockServer.On("GetStore").Return(mockStore)
+
+	mockApp.On("GetOrCreateDirectChannel", invitation.DirectParticipantIDs[0], invitation.DirectParticipantIDs[1], mock.AnythingOfType("model.ChannelOption")).Return(channel, nil)
+	mockApp.On("PatchChannelModerationsForChannel", channel, mock.Anything).Return(nil, nil)
+
+	firstPayload := signTestInvitation(t, scs, remoteCluster.RemoteId, invitation)
+	err := scs.onReceiveChannelInvite(model.RemoteClusterMsg{Payload: firstPayload}, remoteCluster, nil)
+	require.NoError(t, err)
+
+	// A retransmission is re-signed with a fresh envelope (new nonce and
+	// timestamp) but carries the same invitation content and InvitationId.
+	secondPayload := signTestInvitation(t, scs, remoteCluster.RemoteId, invitation)
+	err = scs.onReceiveChannelInvite(model.RemoteClusterMsg{Payload: secondPayload}, remoteCluster, nil)
+	require.NoError(t, err)
+
+	mockChannelStore.AssertNumberOfCalls(t, "Get", 1)
+	mockSharedChannelStore.AssertNumberOfCalls(t, "Save", 1)
+	mockSharedChannelStore.AssertNumberOfCalls(t, "SaveRemote", 1)
+	mockApp.AssertNumberOfCalls(t, "PatchChannelModerationsForChannel", 1)
+}
@@ -0,0 +1,164 @@
+// Copyright (c) 2015-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package sharedchannel
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"sync"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/store"
+)
+
+// InviteKeyStore manages the Ed25519 signing keys used to sign and verify
+// channel invitation envelopes exchanged between remote clusters. Each
+// remote cluster may have more than one known public key at a time so that
+// a key can be rotated without invalidating invitations signed just before
+// the rotation.
+type InviteKeyStore interface {
+	// PublicKey returns the public key registered for the given remote
+	// cluster and key id, if one is known.
+	PublicKey(remoteClusterId, keyId string) (ed25519.PublicKey, bool)
+	// RegisterKey associates a public key with a remote cluster and key id,
+	// making it available for future signature verification.
+	RegisterKey(remoteClusterId, keyId string, publicKey ed25519.PublicKey) error
+	// RotateKey generates a new signing key pair for the given remote
+	// cluster and remembers its public half. The returned key id and
+	// private key are given to the caller, who is responsible for signing
+	// outgoing invitations and sharing the public key with the remote
+	// cluster out of band.
+	RotateKey(remoteClusterId string) (keyId string, publicKey ed25519.PublicKey, privateKey ed25519.PrivateKey, err error)
+}
+
+// memoryInviteKeyStore is an in-memory InviteKeyStore implementation,
+// keeping registered public keys for the lifetime of the service.
+// NewSharedChannelService uses storeInviteKeyStore instead.
+type memoryInviteKeyStore struct {
+	mu   sync.Mutex
+	keys map[string]ed25519.PublicKey // keyed by remoteClusterId + "/" + keyId
+}
+
+func newMemoryInviteKeyStore() *memoryInviteKeyStore {
+	return &memoryInviteKeyStore{
+		keys: make(map[string]ed25519.PublicKey),
+	}
+}
+
+func inviteKeyStoreKey(remoteClusterId, keyId string) string {
+	return remoteClusterId + "/" + keyId
+}
+
+func (s *memoryInviteKeyStore) PublicKey(remoteClusterId, keyId string) (ed25519.PublicKey, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pub, ok := s.keys[inviteKeyStoreKey(remoteClusterId, keyId)]
+	return pub, ok
+}
+
+func (s *memoryInviteKeyStore) RegisterKey(remoteClusterId, keyId string, publicKey ed25519.PublicKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.keys[inviteKeyStoreKey(remoteClusterId, keyId)] = publicKey
+
+	return nil
+}
+
+func (s *memoryInviteKeyStore) RotateKey(remoteClusterId string) (string, ed25519.PublicKey, ed25519.PrivateKey, error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("cannot rotate invite signing key for remote cluster `%s`: %w", remoteClusterId, err)
+	}
+
+	keyId := model.NewId()
+	if err := s.RegisterKey(remoteClusterId, keyId, pub); err != nil {
+		return "", nil, nil, err
+	}
+
+	return keyId, pub, priv, nil
+}
+
+// inviteKeySystemKeyPrefix namespaces the System store keys used by
+// storeInviteKeyStore so they can't collide with unrelated system
+// settings.
+const inviteKeySystemKeyPrefix = "SharedChannelInviteKey_"
+
+// storeInviteKeyStore is the store-backed InviteKeyStore implementation,
+// keeping registered public keys in store.Store().System() like
+// storeInvitationDedupeStore and storePendingInvitationStore. Private keys
+// are never persisted; RotateKey only ever hands the private half back to
+// its caller, who is responsible for using it to sign outgoing invitations.
+type storeInviteKeyStore struct {
+	store store.Store
+}
+
+func newStoreInviteKeyStore(store store.Store) *storeInviteKeyStore {
+	return &storeInviteKeyStore{store: store}
+}
+
+func inviteKeySystemKey(remoteClusterId, keyId string) string {
+	return inviteKeySystemKeyPrefix + inviteKeyStoreKey(remoteClusterId, keyId)
+}
+
+func (s *storeInviteKeyStore) PublicKey(remoteClusterId, keyId string) (ed25519.PublicKey, bool) {
+	system, err := s.store.System().GetByName(inviteKeySystemKey(remoteClusterId, keyId))
+	if err != nil {
+		return nil, false
+	}
+
+	pub, err := base64.StdEncoding.DecodeString(system.Value)
+	if err != nil {
+		return nil, false
+	}
+
+	return ed25519.PublicKey(pub), true
+}
+
+func (s *storeInviteKeyStore) RegisterKey(remoteClusterId, keyId string, publicKey ed25519.PublicKey) error {
+	system := &model.System{
+		Name:  inviteKeySystemKey(remoteClusterId, keyId),
+		Value: base64.StdEncoding.EncodeToString(publicKey),
+	}
+	if err := s.store.System().SaveOrUpdate(system); err != nil {
+		return fmt.Errorf("cannot register invite signing key `%s` for remote cluster `%s`: %w", keyId, remoteClusterId, err)
+	}
+
+	return nil
+}
+
+func (s *storeInviteKeyStore) RotateKey(remoteClusterId string) (string, ed25519.PublicKey, ed25519.PrivateKey, error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("cannot rotate invite signing key for remote cluster `%s`: %w", remoteClusterId, err)
+	}
+
+	keyId := model.NewId()
+	if err := s.RegisterKey(remoteClusterId, keyId, pub); err != nil {
+		return "", nil, nil, err
+	}
+
+	return keyId, pub, priv, nil
+}
+
+// RotateSigningKey generates and registers a new Ed25519 signing key pair
+// for remoteClusterId, returning the key id and private key. The caller is
+// responsible for using the private key to sign outgoing invitations to
+// that remote cluster and sharing the public half with it out of band.
+func (scs *Service) RotateSigningKey(remoteClusterId string) (keyId string, privateKey ed25519.PrivateKey, err error) {
+	keyId, _, privateKey, err = scs.keyStore.RotateKey(remoteClusterId)
+	return keyId, privateKey, err
+}
+
+// RegisterSigningKey registers publicKey as a valid signing key for
+// remoteClusterId and keyId, making it available to verify invitations
+// received from that remote cluster. It is the counterpart a server calls
+// after receiving a remote cluster's public key out of band, e.g. as part
+// of exchanging RotateSigningKey's result with it.
+func (scs *Service) RegisterSigningKey(remoteClusterId, keyId string, publicKey ed25519.PublicKey) error {
+	return scs.keyStore.RegisterKey(remoteClusterId, keyId, publicKey)
+}
@@ -0,0 +1,147 @@
+// Copyright (c) 2015-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package sharedchannel
+
+import (
+	"crypto/ed25519"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+const (
+	// inviteMaxClockSkew bounds how far a signed invitation's timestamp may
+	// drift from this server's clock, in either direction, before it is
+	// rejected as stale.
+	inviteMaxClockSkew = 5 * time.Minute
+
+	// inviteNonceTTL bounds how long a nonce is remembered for replay
+	// detection. Once a nonce falls out of the clock skew window it can
+	// never be replayed with a valid timestamp anyway, so the TTL only
+	// needs to cover that window plus a safety margin.
+	inviteNonceTTL = 15 * time.Minute
+)
+
+// signedInviteEnvelope wraps a channelInviteMsg payload with the
+// information needed to verify that it was produced by the remote cluster
+// it claims to be from, and to reject stale or replayed deliveries.
+type signedInviteEnvelope struct {
+	Payload   []byte `json:"payload"`
+	Signature []byte `json:"signature"`
+	KeyId     string `json:"key_id"`
+	Timestamp int64  `json:"timestamp"`
+	Nonce     string `json:"nonce"`
+}
+
+// signInvitation builds a signed envelope around payload, signed with
+// privateKey and carrying keyId so the receiver can look up the matching
+// public key. remoteClusterId is not used.
+func (scs *Service) signInvitation(remoteClusterId, keyId string, privateKey ed25519.PrivateKey, payload []byte) (*signedInviteEnvelope, error) {
+	envelope := &signedInviteEnvelope{
+		Payload:   payload,
+		KeyId:     keyId,
+		Timestamp: time.Now().Unix(),
+		Nonce:     newInviteNonce(),
+	}
+	envelope.Signature = ed25519.Sign(privateKey, inviteSigningInput(envelope))
+
+	return envelope, nil
+}
+
+// verifyInviteEnvelope checks the signature, freshness, and uniqueness of a
+// received invitation envelope. It must be called before any invitation
+// payload is trusted or acted upon.
+func (scs *Service) verifyInviteEnvelope(envelope *signedInviteEnvelope, rc *model.RemoteCluster) error {
+	publicKey, ok := scs.keyStore.PublicKey(rc.RemoteId, envelope.KeyId)
+	if !ok {
+		return fmt.Errorf("unknown signing key `%s`", envelope.KeyId)
+	}
+
+	if !ed25519.Verify(publicKey, inviteSigningInput(envelope), envelope.Signature) {
+		return errors.New("invalid signature")
+	}
+
+	age := time.Since(time.Unix(envelope.Timestamp, 0))
+	if age > inviteMaxClockSkew || age < -inviteMaxClockSkew {
+		return fmt.Errorf("timestamp outside allowed clock skew: %s", time.Unix(envelope.Timestamp, 0))
+	}
+
+	if !scs.registerInviteNonce(rc.RemoteId, envelope.Nonce) {
+		return fmt.Errorf("duplicate nonce `%s`", envelope.Nonce)
+	}
+
+	return nil
+}
+
+// registerInviteNonce remembers that nonce has been seen for
+// remoteClusterId, returning false if it was already seen within
+// inviteNonceTTL.
+func (scs *Service) registerInviteNonce(remoteClusterId, nonce string) bool {
+	scs.nonceMu.Lock()
+	defer scs.nonceMu.Unlock()
+
+	if scs.seenNonces == nil {
+		scs.seenNonces = make(map[string]time.Time)
+	}
+
+	now := time.Now()
+	for key, seenAt := range scs.seenNonces {
+		if now.Sub(seenAt) > inviteNonceTTL {
+			delete(scs.seenNonces, key)
+		}
+	}
+
+	key := remoteClusterId + "/" + nonce
+	if _, exists := scs.seenNonces[key]; exists {
+		return false
+	}
+	scs.seenNonces[key] = now
+
+	return true
+}
+
+// inviteSigningInput builds the deterministic byte sequence that is signed
+// and verified for an invitation envelope. The signature itself is never
+// part of the input.
+//
+// Payload, KeyId and Nonce are length-prefixed and Timestamp is encoded as
+// a fixed 8-byte big-endian integer, so every field has an unambiguous
+// boundary in the resulting byte sequence. A naive concatenation would let
+// two different (payload, keyId) splits produce the identical signed bytes
+// (e.g. payload "ab"+keyId "c" vs payload "a"+keyId "bc"), letting a valid
+// signature over one be replayed as a signature over the other.
+func inviteSigningInput(envelope *signedInviteEnvelope) []byte {
+	input := make([]byte, 0, len(envelope.Payload)+len(envelope.KeyId)+len(envelope.Nonce)+24)
+	input = appendLengthPrefixed(input, envelope.Payload)
+	input = appendLengthPrefixed(input, []byte(envelope.KeyId))
+	input = appendUint64(input, uint64(envelope.Timestamp))
+	input = appendLengthPrefixed(input, []byte(envelope.Nonce))
+	return input
+}
+
+// appendLengthPrefixed appends a 4-byte big-endian length prefix followed
+// by field to dst, giving the field an unambiguous boundary regardless of
+// what bytes it contains or what follows it.
+func appendLengthPrefixed(dst, field []byte) []byte {
+	var length [4]byte
+	binary.BigEndian.PutUint32(length[:], uint32(len(field)))
+	dst = append(dst, length[:]...)
+	return append(dst, field...)
+}
+
+// appendUint64 appends v to dst as a fixed 8-byte big-endian integer.
+func appendUint64(dst []byte, v uint64) []byte {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], v)
+	return append(dst, buf[:]...)
+}
+
+// newInviteNonce returns a fresh random nonce suitable for a single
+// invitation envelope.
+func newInviteNonce() string {
+	return model.NewId()
+}
@@ -0,0 +1,232 @@
+// Copyright (c) 2015-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package sharedchannel
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/store"
+)
+
+// PendingInvitationStatus is the lifecycle state of a PendingInvitation.
+type PendingInvitationStatus string
+
+const (
+	PendingInvitationStatusPending  PendingInvitationStatus = "pending"
+	PendingInvitationStatusApproved PendingInvitationStatus = "approved"
+	PendingInvitationStatusRejected PendingInvitationStatus = "rejected"
+)
+
+// PendingInvitation is a channel invitation that an InvitationPolicy has
+// deferred, awaiting admin approval or rejection before the channel is
+// created and shared.
+type PendingInvitation struct {
+	Id              string
+	RemoteClusterId string
+
+	// RemoteClusterCreatorId is copied from the inviting model.RemoteCluster
+	// at defer time so that ApproveInvitation can later run shareChannel
+	// without reconstructing a stub RemoteCluster that is missing fields
+	// shareChannel depends on.
+	RemoteClusterCreatorId string
+
+	Invitation channelInviteMsg
+	Status     PendingInvitationStatus
+	CreateAt   int64
+}
+
+// PendingInvitationStore persists invitations that an InvitationPolicy has
+// deferred, awaiting admin approval or rejection.
+type PendingInvitationStore interface {
+	Save(invitation *PendingInvitation) (*PendingInvitation, error)
+	Get(id string) (*PendingInvitation, error)
+	List() ([]*PendingInvitation, error)
+	UpdateStatus(id string, status PendingInvitationStatus) (*PendingInvitation, error)
+}
+
+type memoryPendingInvitationStore struct {
+	mu   sync.Mutex
+	byID map[string]*PendingInvitation
+}
+
+func newMemoryPendingInvitationStore() *memoryPendingInvitationStore {
+	return &memoryPendingInvitationStore{
+		byID: make(map[string]*PendingInvitation),
+	}
+}
+
+func (s *memoryPendingInvitationStore) Save(invitation *PendingInvitation) (*PendingInvitation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if invitation.Id == "" {
+		invitation.Id = model.NewId()
+	}
+	if invitation.Status == "" {
+		invitation.Status = PendingInvitationStatusPending
+	}
+	if invitation.CreateAt == 0 {
+		invitation.CreateAt = time.Now().UnixNano() / int64(time.Millisecond)
+	}
+
+	saved := *invitation
+	s.byID[saved.Id] = &saved
+
+	return &saved, nil
+}
+
+func (s *memoryPendingInvitationStore) Get(id string) (*PendingInvitation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	invitation, ok := s.byID[id]
+	if !ok {
+		return nil, fmt.Errorf("pending invitation not found: %s", id)
+	}
+
+	found := *invitation
+	return &found, nil
+}
+
+func (s *memoryPendingInvitationStore) List() ([]*PendingInvitation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	invitations := make([]*PendingInvitation, 0, len(s.byID))
+	for _, invitation := range s.byID {
+		copied := *invitation
+		invitations = append(invitations, &copied)
+	}
+
+	return invitations, nil
+}
+
+func (s *memoryPendingInvitationStore) UpdateStatus(id string, status PendingInvitationStatus) (*PendingInvitation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	invitation, ok := s.byID[id]
+	if !ok {
+		return nil, fmt.Errorf("pending invitation not found: %s", id)
+	}
+
+	invitation.Status = status
+	updated := *invitation
+
+	return &updated, nil
+}
+
+// pendingInvitationSystemKeyPrefix namespaces the System store keys used by
+// storePendingInvitationStore so they can't collide with unrelated system
+// settings.
+const pendingInvitationSystemKeyPrefix = "SharedChannelPendingInvite_"
+
+// storePendingInvitationStore is a PendingInvitationStore backed by
+// store.Store().System(), mirroring storeInvitationDedupeStore. It keeps
+// pending invitations durable across restarts and visible to every node in
+// the cluster, which the store-backed dedupe record a deferred invitation
+// gets in onReceiveChannelInvite already assumes: without this, a
+// restarted server would lose every pending invitation while the dedupe
+// cache (also store-backed) kept remembering it as already handled,
+// permanently hiding it from ListPendingInvitations.
+type storePendingInvitationStore struct {
+	store store.Store
+}
+
+func newStorePendingInvitationStore(store store.Store) *storePendingInvitationStore {
+	return &storePendingInvitationStore{store: store}
+}
+
+func pendingInvitationSystemKey(id string) string {
+	return pendingInvitationSystemKeyPrefix + id
+}
+
+func (s *storePendingInvitationStore) Save(invitation *PendingInvitation) (*PendingInvitation, error) {
+	if invitation.Id == "" {
+		invitation.Id = model.NewId()
+	}
+	if invitation.Status == "" {
+		invitation.Status = PendingInvitationStatusPending
+	}
+	if invitation.CreateAt == 0 {
+		invitation.CreateAt = time.Now().UnixNano() / int64(time.Millisecond)
+	}
+
+	saved := *invitation
+	if err := s.save(&saved); err != nil {
+		return nil, err
+	}
+
+	return &saved, nil
+}
+
+func (s *storePendingInvitationStore) save(invitation *PendingInvitation) error {
+	value, err := json.Marshal(invitation)
+	if err != nil {
+		return fmt.Errorf("cannot encode pending invitation `%s`: %w", invitation.Id, err)
+	}
+
+	system := &model.System{Name: pendingInvitationSystemKey(invitation.Id), Value: string(value)}
+	if err := s.store.System().SaveOrUpdate(system); err != nil {
+		return fmt.Errorf("cannot persist pending invitation `%s`: %w", invitation.Id, err)
+	}
+
+	return nil
+}
+
+func (s *storePendingInvitationStore) Get(id string) (*PendingInvitation, error) {
+	system, err := s.store.System().GetByName(pendingInvitationSystemKey(id))
+	if err != nil {
+		return nil, fmt.Errorf("pending invitation not found: %s", id)
+	}
+
+	var invitation PendingInvitation
+	if err := json.Unmarshal([]byte(system.Value), &invitation); err != nil {
+		return nil, fmt.Errorf("cannot decode pending invitation `%s`: %w", id, err)
+	}
+
+	return &invitation, nil
+}
+
+func (s *storePendingInvitationStore) List() ([]*PendingInvitation, error) {
+	all, err := s.store.System().Get()
+	if err != nil {
+		return nil, fmt.Errorf("cannot list pending invitations: %w", err)
+	}
+
+	invitations := make([]*PendingInvitation, 0, len(all))
+	for key, value := range all {
+		if !strings.HasPrefix(key, pendingInvitationSystemKeyPrefix) {
+			continue
+		}
+
+		var invitation PendingInvitation
+		if err := json.Unmarshal([]byte(value), &invitation); err != nil {
+			return nil, fmt.Errorf("cannot decode pending invitation `%s`: %w", key, err)
+		}
+
+		invitations = append(invitations, &invitation)
+	}
+
+	return invitations, nil
+}
+
+func (s *storePendingInvitationStore) UpdateStatus(id string, status PendingInvitationStatus) (*PendingInvitation, error) {
+	invitation, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	invitation.Status = status
+	if err := s.save(invitation); err != nil {
+		return nil, err
+	}
+
+	return invitation, nil
+}
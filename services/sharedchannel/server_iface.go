@@ -0,0 +1,17 @@
+// Copyright (c) 2015-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package sharedchannel
+
+import (
+	"github.com/mattermost/mattermost-server/v5/mlog"
+	"github.com/mattermost/mattermost-server/v5/store"
+)
+
+// ServerIface is the interface to the subset of the suite server that the
+// shared channel service depends on. It exists so the service can be unit
+// tested without standing up a full server.
+type ServerIface interface {
+	GetStore() store.Store
+	GetLogger() mlog.LoggerIFace
+}
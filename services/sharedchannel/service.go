@@ -0,0 +1,49 @@
+// Copyright (c) 2015-present Mattermost, Inc. All Rights Reserved.
+// See LICENSE.txt for license information.
+
+package sharedchannel
+
+import (
+	"sync"
+	"time"
+)
+
+// Service handles the synchronization of shared channels and their
+// membership/content between clusters connected via remote cluster
+// invitations.
+type Service struct {
+	server ServerIface
+	app    AppIface
+
+	keyStore InviteKeyStore
+
+	nonceMu    sync.Mutex
+	seenNonces map[string]time.Time
+
+	policy  InvitationPolicy
+	pending PendingInvitationStore
+
+	dedupe InvitationDedupeStore
+}
+
+// NewSharedChannelService creates a Service bound to the given server and
+// app. The returned service is ready to receive remote cluster messages.
+// By default every invitation is accepted immediately; use
+// SetInvitationPolicy to require allowlisting or admin approval.
+func NewSharedChannelService(server ServerIface, app AppIface) *Service {
+	return &Service{
+		server:     server,
+		app:        app,
+		keyStore:   newStoreInviteKeyStore(server.GetStore()),
+		seenNonces: make(map[string]time.Time),
+		policy:     autoAcceptPolicy{},
+		pending:    newStorePendingInvitationStore(server.GetStore()),
+		dedupe:     newStoreInvitationDedupeStore(server.GetStore()),
+	}
+}
+
+// SetInvitationPolicy changes the policy used to decide whether incoming
+// channel invitations are accepted immediately or deferred as pending.
+func (scs *Service) SetInvitationPolicy(policy InvitationPolicy) {
+	scs.policy = policy
+}